@@ -5,17 +5,21 @@
 package subsonic
 
 import (
+	"context"
 	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
-	"math/rand"
+	"math/big"
 	"net/http"
 	"net/url"
 	"path"
+
+	"golang.org/x/sync/singleflight"
 )
 
 const (
@@ -23,48 +27,177 @@ const (
 	libraryVersion      = "0.0.4"
 )
 
+// AuthMode selects how Client.Authenticate negotiates credentials with the
+// server.
+type AuthMode int
+
+const (
+	// AuthToken sends the salted MD5 token (t/s params). This is the
+	// default and preferred mode, but requires Subsonic >= 1.13.0.
+	AuthToken AuthMode = iota
+	// AuthPassword sends the password hex-encoded as p=enc:<hex>, for
+	// servers that predate salted tokens (Subsonic < 1.13.0, some Airsonic
+	// forks, and Ampache's Subsonic API shim).
+	AuthPassword
+	// AuthAuto tries AuthToken first and, if the server reports error code
+	// 41 ("token authentication not supported"), transparently retries with
+	// AuthPassword and latches the Client to it for subsequent requests.
+	AuthAuto
+)
+
+// errCodeTokenAuthNotSupported is the Subsonic API error code returned when
+// a server predates salted token authentication.
+const errCodeTokenAuthNotSupported = 41
+
+// defaultSaltLength is the salt length, in characters, used by Authenticate
+// when no SaltLength is given. The Subsonic spec requires at least 6; this
+// is sized generously for entropy instead of the historical minimum: 22
+// base62 characters carry about 131 bits, at least 16 bytes of entropy.
+const defaultSaltLength = 22
+
+// saltCorpus is the base62 alphabet salts are drawn from.
+const saltCorpus = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
 type Client struct {
 	Client     *http.Client
 	BaseUrl    string
 	User       string
 	ClientName string
+	AuthMode   AuthMode
 	salt       string
 	token      string
+	password   string
+
+	middlewares []Middleware
+	serverInfo  *ServerInfo
+	coverCache  CoverArtCache
+	coverGroup  singleflight.Group
+}
+
+// ApiError represents an error response from the Subsonic API, as described
+// at http://www.subsonic.org/pages/api.jsp.
+type ApiError struct {
+	Code    int
+	Message string
 }
 
-func generateSalt() string {
-	var corpus = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
-	// length is minimum 6, but let's use ten to start
-	b := make([]rune, 10)
+func (e *ApiError) Error() string {
+	return fmt.Sprintf("Error #%d: %s", e.Code, e.Message)
+}
+
+// generateSalt draws length characters (at least 6) uniformly from the
+// base62 alphabet using crypto/rand, so salts are unpredictable across
+// processes (unlike math/rand, which
+// without an explicit seed repeats the same sequence every run).
+func generateSalt(length int) (string, error) {
+	if length < 6 {
+		length = 6
+	}
+	corpusSize := big.NewInt(int64(len(saltCorpus)))
+	b := make([]byte, length)
 	for i := range b {
-		b[i] = corpus[rand.Intn(len(corpus))]
+		n, err := rand.Int(rand.Reader, corpusSize)
+		if err != nil {
+			return "", err
+		}
+		b[i] = saltCorpus[n.Int64()]
 	}
-	return string(b)
+	return string(b), nil
 }
 
-// Authenticate authenticates the current user with a provided password. The password is salted before transmission and requires Subsonic > 1.13.0.
-func (s *Client) Authenticate(password string) error {
-	salt := generateSalt()
-	h := md5.New()
-	_, err := io.WriteString(h, password)
+func (s *Client) authenticateToken(password string, saltLength int) error {
+	salt, err := generateSalt(saltLength)
 	if err != nil {
 		return err
 	}
-	_, err = io.WriteString(h, salt)
-	if err != nil {
+	h := md5.New()
+	if _, err := io.WriteString(h, password); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(h, salt); err != nil {
 		return err
 	}
 	s.salt = salt
 	s.token = fmt.Sprintf("%x", h.Sum(nil))
+	return nil
+}
+
+// AuthenticationError wraps the cause of an Authenticate failure, so callers
+// can distinguish the server rejecting the credentials (Err is an *ApiError)
+// from the request never reaching it (a network, DNS, or TLS failure).
+type AuthenticationError struct {
+	Err error
+}
+
+func (e *AuthenticationError) Error() string {
+	return fmt.Sprintf("authentication failed: %s", e.Err)
+}
+
+func (e *AuthenticationError) Unwrap() error {
+	return e.Err
+}
+
+// Authenticate authenticates the current user with a provided password,
+// using the strategy selected by Client.AuthMode (AuthToken by default).
+// AuthToken salts the password before transmission and requires Subsonic >=
+// 1.13.0; AuthPassword sends it hex-encoded for older servers; AuthAuto
+// tries AuthToken first and falls back to AuthPassword automatically if the
+// server reports error code 41 (token authentication not supported); any
+// other error is returned and AuthMode stays AuthAuto.
+//
+// saltLength optionally overrides the number of characters generated for
+// the AuthToken salt (default defaultSaltLength); it is ignored in
+// AuthPassword mode. At most one value may be given.
+func (s *Client) Authenticate(password string, saltLength ...int) error {
+	length := defaultSaltLength
+	if len(saltLength) > 0 {
+		length = saltLength[0]
+	}
+
+	switch s.AuthMode {
+	case AuthPassword:
+		s.password = password
+	case AuthAuto:
+		if err := s.authenticateToken(password, length); err != nil {
+			return err
+		}
+		_, err := s.Get("ping", nil)
+		if err != nil {
+			var apiErr *ApiError
+			if !errors.As(err, &apiErr) || apiErr.Code != errCodeTokenAuthNotSupported {
+				return &AuthenticationError{Err: err}
+			}
+			s.token, s.salt = "", ""
+			s.AuthMode = AuthPassword
+			s.password = password
+		}
+	default:
+		if err := s.authenticateToken(password, length); err != nil {
+			return err
+		}
+	}
+
 	// Test authentication
-	if !s.Ping() {
-		return errors.New("Authentication failed")
+	if _, err := s.Get("ping", nil); err != nil {
+		return &AuthenticationError{Err: err}
 	}
 	return nil
 }
 
-// Request performs a HTTP request against the Subsonic server as the current user.
-func (s *Client) Request(method string, endpoint string, params map[string]string) (*http.Response, error) {
+// Logout clears the Client's references to the salt, token, and any
+// plaintext password cached for AuthPassword mode. It does not scrub the
+// underlying memory — Go strings offer no way to do that — so copies of
+// those values may still linger on the heap until garbage collected.
+func (s *Client) Logout() {
+	s.salt = ""
+	s.token = ""
+	s.password = ""
+}
+
+// buildRequest constructs, but does not send, an *http.Request against the
+// Subsonic server for the given endpoint, with authentication and params
+// encoded into the query string.
+func (s *Client) buildRequest(method string, endpoint string, params map[string]string) (*http.Request, error) {
 	baseUrl, err := url.Parse(s.BaseUrl)
 	if err != nil {
 		return nil, err
@@ -80,23 +213,40 @@ func (s *Client) Request(method string, endpoint string, params map[string]strin
 	q.Add("v", supportedApiVersion)
 	q.Add("c", s.ClientName)
 	q.Add("u", s.User)
-	q.Add("t", s.token)
-	q.Add("s", s.salt)
+	switch s.AuthMode {
+	case AuthPassword:
+		q.Add("p", "enc:"+hex.EncodeToString([]byte(s.password)))
+	default:
+		q.Add("t", s.token)
+		q.Add("s", s.salt)
+	}
 	for key, val := range params {
 		q.Add(key, val)
 	}
 	req.URL.RawQuery = q.Encode()
+	return req, nil
+}
 
-	resp, err := s.Client.Do(req)
+// RequestContext performs a HTTP request against the Subsonic server as the
+// current user, running it through any middlewares installed via Client.Use
+// and stopping early if ctx is done.
+func (s *Client) RequestContext(ctx context.Context, method string, endpoint string, params map[string]string) (*http.Response, error) {
+	req, err := s.buildRequest(method, endpoint, params)
 	if err != nil {
 		return nil, err
 	}
-	return resp, nil
+	req = req.WithContext(ctx)
+	return s.roundTripper()(req)
 }
 
-// Get is a convenience interface to issue a GET request and parse the response body (99% of Subsonic API calls)
-func (s *Client) Get(endpoint string, params map[string]string) (*subsonicResponse, error) {
-	response, err := s.Request("GET", endpoint, params)
+// Request performs a HTTP request against the Subsonic server as the current user.
+func (s *Client) Request(method string, endpoint string, params map[string]string) (*http.Response, error) {
+	return s.RequestContext(context.Background(), method, endpoint, params)
+}
+
+// GetContext is the context-aware variant of Get.
+func (s *Client) GetContext(ctx context.Context, endpoint string, params map[string]string) (*subsonicResponse, error) {
+	response, err := s.RequestContext(ctx, "GET", endpoint, params)
 	if err != nil {
 		return nil, err
 	}
@@ -104,7 +254,6 @@ func (s *Client) Get(endpoint string, params map[string]string) (*subsonicRespon
 	if err != nil {
 		return nil, err
 	}
-	//log.Printf("%s: %s\n", endpoint, contents)
 	parsed := apiResponse{}
 	err = json.Unmarshal(responseBody, &parsed)
 	if err != nil {
@@ -112,26 +261,37 @@ func (s *Client) Get(endpoint string, params map[string]string) (*subsonicRespon
 	}
 	resp := parsed.Response
 	if resp.Error != nil {
-		return nil, fmt.Errorf("Error #%d: %s\n", resp.Error.Code, resp.Error.Message)
+		return nil, &ApiError{Code: resp.Error.Code, Message: resp.Error.Message}
 	}
 	return resp, nil
 }
 
+// Get is a convenience interface to issue a GET request and parse the response body (99% of Subsonic API calls)
+func (s *Client) Get(endpoint string, params map[string]string) (*subsonicResponse, error) {
+	return s.GetContext(context.Background(), endpoint, params)
+}
+
+// PingContext is the context-aware variant of Ping.
+func (s *Client) PingContext(ctx context.Context) bool {
+	_, err := s.RequestContext(ctx, "GET", "ping", nil)
+	return err == nil
+}
+
 // Ping is used to test connectivity with the server. It returns true if the server is up.
 func (s *Client) Ping() bool {
-	_, err := s.Request("GET", "ping", nil)
-	if err != nil {
-		log.Println(err)
-		return false
-	}
-	return true
+	return s.PingContext(context.Background())
 }
 
-// GetLicense retrieves details about the software license. Subsonic requires a license after a 30-day trial, compatible applications have a perpetually valid license.
-func (s *Client) GetLicense() (*License, error) {
-	resp, err := s.Get("getLicense", nil)
+// GetLicenseContext is the context-aware variant of GetLicense.
+func (s *Client) GetLicenseContext(ctx context.Context) (*License, error) {
+	resp, err := s.GetContext(ctx, "getLicense", nil)
 	if err != nil {
 		return nil, err
 	}
 	return resp.License, nil
+}
+
+// GetLicense retrieves details about the software license. Subsonic requires a license after a 30-day trial, compatible applications have a perpetually valid license.
+func (s *Client) GetLicense() (*License, error) {
+	return s.GetLicenseContext(context.Background())
 }
\ No newline at end of file
@@ -0,0 +1,142 @@
+package subsonic
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestGenerateSaltUniqueness(t *testing.T) {
+	seen := make(map[string]bool, 10000)
+	for i := 0; i < 10000; i++ {
+		salt, err := generateSalt(defaultSaltLength)
+		if err != nil {
+			t.Fatalf("generateSalt: %v", err)
+		}
+		if seen[salt] {
+			t.Fatalf("duplicate salt generated: %q", salt)
+		}
+		seen[salt] = true
+	}
+}
+
+func TestAuthenticateRejectedBySubsonicServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"subsonic-response":{"status":"failed","error":{"code":40,"message":"Wrong username or password."}}}`))
+	}))
+	defer server.Close()
+
+	client := &Client{Client: server.Client(), BaseUrl: server.URL, User: "demo", ClientName: "go-subsonic-test"}
+	err := client.Authenticate("wrong-password")
+
+	var authErr *AuthenticationError
+	if !errors.As(err, &authErr) {
+		t.Fatalf("expected *AuthenticationError, got %T: %v", err, err)
+	}
+	var apiErr *ApiError
+	if !errors.As(authErr.Err, &apiErr) {
+		t.Fatalf("expected rejection to wrap *ApiError, got %T: %v", authErr.Err, authErr.Err)
+	}
+	if apiErr.Code != 40 {
+		t.Fatalf("expected error code 40, got %d", apiErr.Code)
+	}
+}
+
+func TestAuthenticatePasswordModeEncodesPlaintext(t *testing.T) {
+	var gotQuery url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"subsonic-response":{"status":"ok"}}`))
+	}))
+	defer server.Close()
+
+	client := &Client{Client: server.Client(), BaseUrl: server.URL, User: "demo", ClientName: "go-subsonic-test", AuthMode: AuthPassword}
+	if err := client.Authenticate("sesame"); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+
+	want := "enc:" + hex.EncodeToString([]byte("sesame"))
+	if got := gotQuery.Get("p"); got != want {
+		t.Fatalf("expected p=%q, got %q", want, got)
+	}
+	if gotQuery.Get("t") != "" || gotQuery.Get("s") != "" {
+		t.Fatalf("expected no token/salt params in AuthPassword mode, got t=%q s=%q", gotQuery.Get("t"), gotQuery.Get("s"))
+	}
+}
+
+func TestAuthenticateAutoFallsBackToPasswordOnCode41(t *testing.T) {
+	var queries []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query())
+		w.Header().Set("Content-Type", "application/json")
+		if len(queries) == 1 {
+			w.Write([]byte(`{"subsonic-response":{"status":"failed","error":{"code":41,"message":"Token authentication not supported."}}}`))
+			return
+		}
+		w.Write([]byte(`{"subsonic-response":{"status":"ok"}}`))
+	}))
+	defer server.Close()
+
+	client := &Client{Client: server.Client(), BaseUrl: server.URL, User: "demo", ClientName: "go-subsonic-test", AuthMode: AuthAuto}
+	if err := client.Authenticate("sesame"); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+
+	if client.AuthMode != AuthPassword {
+		t.Fatalf("expected AuthMode to latch to AuthPassword after code 41, got %v", client.AuthMode)
+	}
+
+	want := "enc:" + hex.EncodeToString([]byte("sesame"))
+	if got := queries[len(queries)-1].Get("p"); got != want {
+		t.Fatalf("expected the retest ping after fallback to send p=%q, got %q", want, got)
+	}
+
+	if _, err := client.Get("ping", nil); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got := queries[len(queries)-1].Get("p"); got != want {
+		t.Fatalf("expected a later request to stay latched to AuthPassword, got p=%q", got)
+	}
+}
+
+func TestAuthenticateAutoPropagatesNonCode41Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"subsonic-response":{"status":"failed","error":{"code":40,"message":"Wrong username or password."}}}`))
+	}))
+	defer server.Close()
+
+	client := &Client{Client: server.Client(), BaseUrl: server.URL, User: "demo", ClientName: "go-subsonic-test", AuthMode: AuthAuto}
+	err := client.Authenticate("sesame")
+
+	var authErr *AuthenticationError
+	if !errors.As(err, &authErr) {
+		t.Fatalf("expected *AuthenticationError, got %T: %v", err, err)
+	}
+	var apiErr *ApiError
+	if !errors.As(authErr.Err, &apiErr) || apiErr.Code != 40 {
+		t.Fatalf("expected the wrapped error to be *ApiError code 40, got %v", authErr.Err)
+	}
+	if client.AuthMode != AuthAuto {
+		t.Fatalf("expected AuthMode to stay AuthAuto after a non-41 failure, got %v", client.AuthMode)
+	}
+}
+
+func TestAuthenticateNetworkFailure(t *testing.T) {
+	client := &Client{Client: http.DefaultClient, BaseUrl: "http://127.0.0.1:1", User: "demo", ClientName: "go-subsonic-test"}
+	err := client.Authenticate("anything")
+
+	var authErr *AuthenticationError
+	if !errors.As(err, &authErr) {
+		t.Fatalf("expected *AuthenticationError, got %T: %v", err, err)
+	}
+	var apiErr *ApiError
+	if errors.As(authErr.Err, &apiErr) {
+		t.Fatalf("expected a transport error, got an *ApiError: %v", apiErr)
+	}
+}
@@ -0,0 +1,254 @@
+package subsonic
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// CoverArtCache stores and retrieves raw cover art bytes keyed by an opaque
+// cache key (GetCoverArt keys on coverArtId and requested size together).
+// Implementations must be safe for concurrent use.
+type CoverArtCache interface {
+	// Get returns the cached bytes for key, and whether they were found.
+	// The caller is responsible for closing the returned ReadCloser.
+	Get(key string) (io.ReadCloser, bool)
+	// Put stores the contents of r under key, consuming it fully.
+	Put(key string, r io.Reader) error
+}
+
+// DiskCoverArtCache is a CoverArtCache backed by files on disk, evicting the
+// least recently used entries once more than maxEntries are stored.
+type DiskCoverArtCache struct {
+	dir        string
+	maxEntries int
+
+	mu    sync.Mutex
+	order []string // least-recently-used first
+}
+
+// NewDiskCoverArtCache creates a DiskCoverArtCache rooted at dir, creating
+// the directory if necessary and retaining at most maxEntries cover images.
+func NewDiskCoverArtCache(dir string, maxEntries int) (*DiskCoverArtCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	// ReadDir returns entries sorted by filename (the sha1 hash of the cache
+	// key), not by recency, so re-sort by ModTime to seed order as oldest
+	// access first, matching what touch/evict expect.
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ModTime().Before(entries[j].ModTime())
+	})
+	c := &DiskCoverArtCache{dir: dir, maxEntries: maxEntries}
+	for _, e := range entries {
+		c.order = append(c.order, e.Name())
+	}
+	return c, nil
+}
+
+func (c *DiskCoverArtCache) path(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+// Get implements CoverArtCache.
+func (c *DiskCoverArtCache) Get(key string) (io.ReadCloser, bool) {
+	f, err := os.Open(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	c.touch(filepath.Base(c.path(key)))
+	return f, true
+}
+
+// Put implements CoverArtCache.
+func (c *DiskCoverArtCache) Put(key string, r io.Reader) error {
+	dest := c.path(key)
+	tmp := dest + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		return err
+	}
+
+	c.touch(filepath.Base(dest))
+	c.evict()
+	return nil
+}
+
+func (c *DiskCoverArtCache) touch(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, n := range c.order {
+		if n == name {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	c.order = append(c.order, name)
+}
+
+func (c *DiskCoverArtCache) evict() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.maxEntries > 0 && len(c.order) > c.maxEntries {
+		oldest := c.order[0]
+		c.order = c.order[1:]
+		os.Remove(filepath.Join(c.dir, oldest))
+	}
+}
+
+// coverArtResult is the value cached per in-flight GetCoverArt call by
+// Client.coverGroup.
+type coverArtResult struct {
+	body        []byte
+	contentType string
+}
+
+// WithCoverCache installs cache as the Client's cover art cache, letting
+// GetCoverArt serve repeat requests for the same (id, size) from disk
+// instead of the network. It returns the Client for chaining.
+func (s *Client) WithCoverCache(cache CoverArtCache) *Client {
+	s.coverCache = cache
+	return s
+}
+
+// GetCoverArt retrieves the cover art for coverArtId, scaled to size pixels
+// square (pass 0 to let the server choose its default size). A cache
+// installed via WithCoverCache is consulted first, and populated on a
+// cache miss. Concurrent calls for the same id and size are coalesced into
+// a single network request.
+func (s *Client) GetCoverArt(id string, size int) (io.ReadCloser, string, error) {
+	return s.GetCoverArtContext(context.Background(), id, size)
+}
+
+// GetCoverArtContext is the context-aware variant of GetCoverArt.
+func (s *Client) GetCoverArtContext(ctx context.Context, id string, size int) (io.ReadCloser, string, error) {
+	key := fmt.Sprintf("%s_%d", id, size)
+
+	if s.coverCache != nil {
+		if cached, ok := s.coverCache.Get(key); ok {
+			return decodeCoverArtEntry(cached)
+		}
+	}
+
+	// DoChan registers this call against the group synchronously before
+	// returning, so (unlike wrapping coverGroup.Do in our own goroutine)
+	// concurrent callers can't be scheduled late enough to miss a
+	// fast-finishing leader and each start their own redundant fetch.
+	ch := s.coverGroup.DoChan(key, func() (interface{}, error) {
+		params := map[string]string{"id": id}
+		if size > 0 {
+			params["size"] = strconv.Itoa(size)
+		}
+
+		// This closure runs once and its result is shared across every
+		// caller currently waiting on this key, so it must not be tied to
+		// any single caller's ctx — otherwise one caller's cancellation or
+		// timeout would fail the request for everyone else still waiting.
+		// The leader keeps running to completion (and populates the cache)
+		// even if the caller that triggered it below gives up on its own
+		// ctx first.
+		resp, err := s.RequestContext(context.Background(), "GET", "getCoverArt", params)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		streamErr, replacement, err := asStreamError(resp)
+		if err != nil {
+			return nil, err
+		}
+		if streamErr != nil {
+			return nil, streamErr
+		}
+
+		streamBody := resp.Body
+		if replacement != nil {
+			streamBody = replacement
+		}
+		body, err := ioutil.ReadAll(streamBody)
+		if err != nil {
+			return nil, err
+		}
+		contentType := resp.Header.Get("Content-Type")
+		if contentType == "" {
+			contentType = http.DetectContentType(body)
+		}
+
+		if s.coverCache != nil {
+			if err := s.coverCache.Put(key, bytes.NewReader(encodeCoverArtEntry(contentType, body))); err != nil {
+				return nil, err
+			}
+		}
+
+		return &coverArtResult{body: body, contentType: contentType}, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, "", ctx.Err()
+	case r := <-ch:
+		if r.Err != nil {
+			return nil, "", r.Err
+		}
+		res := r.Val.(*coverArtResult)
+		return ioutil.NopCloser(bytes.NewReader(res.body)), res.contentType, nil
+	}
+}
+
+// coverArtEntrySeparator separates the content type from the image bytes in
+// what CoverArtCache implementations actually store, so a cache hit reports
+// the same Content-Type the original response did instead of re-sniffing it
+// from the image bytes (which fails for any format the magic-byte sniffer
+// doesn't recognize).
+const coverArtEntrySeparator = '\x00'
+
+// encodeCoverArtEntry prepends contentType to body for storage in a
+// CoverArtCache.
+func encodeCoverArtEntry(contentType string, body []byte) []byte {
+	entry := make([]byte, 0, len(contentType)+1+len(body))
+	entry = append(entry, contentType...)
+	entry = append(entry, coverArtEntrySeparator)
+	entry = append(entry, body...)
+	return entry
+}
+
+// decodeCoverArtEntry splits a CoverArtCache entry back into its original
+// Content-Type and image bytes.
+func decodeCoverArtEntry(r io.ReadCloser) (io.ReadCloser, string, error) {
+	data, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	if i := bytes.IndexByte(data, coverArtEntrySeparator); i >= 0 {
+		return ioutil.NopCloser(bytes.NewReader(data[i+1:])), string(data[:i]), nil
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), http.DetectContentType(data), nil
+}
@@ -0,0 +1,138 @@
+package subsonic
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGetCoverArtCoalescesConcurrentRequests(t *testing.T) {
+	var requests int
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte("jpeg-bytes"))
+	}))
+	defer server.Close()
+
+	client := &Client{Client: server.Client(), BaseUrl: server.URL, User: "demo", ClientName: "go-subsonic-test"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, _, err := client.GetCoverArt("cover-1", 300)
+			if err != nil {
+				t.Errorf("GetCoverArt: %v", err)
+				return
+			}
+			defer r.Close()
+			if _, err := ioutil.ReadAll(r); err != nil {
+				t.Errorf("ReadAll: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requests != 1 {
+		t.Fatalf("expected 20 concurrent requests for the same cover to coalesce into 1, got %d", requests)
+	}
+}
+
+func TestGetCoverArtServesFromCacheOnSecondCall(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte("jpeg-bytes"))
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	cache, err := NewDiskCoverArtCache(cacheDir, 10)
+	if err != nil {
+		t.Fatalf("NewDiskCoverArtCache: %v", err)
+	}
+
+	client := (&Client{Client: server.Client(), BaseUrl: server.URL, User: "demo", ClientName: "go-subsonic-test"}).WithCoverCache(cache)
+
+	for i := 0; i < 2; i++ {
+		r, contentType, err := client.GetCoverArt("cover-1", 300)
+		if err != nil {
+			t.Fatalf("GetCoverArt: %v", err)
+		}
+		body, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("ReadAll: %v", err)
+		}
+		if string(body) != "jpeg-bytes" {
+			t.Fatalf("expected cached bytes to round-trip, got %q", body)
+		}
+		if contentType != "image/jpeg" {
+			t.Fatalf("expected the response's content type image/jpeg, got %q", contentType)
+		}
+	}
+
+	if requests != 1 {
+		t.Fatalf("expected the second call to be served from cache, got %d network requests", requests)
+	}
+}
+
+func TestGetCoverArtContextCancelReturnsEarly(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte("jpeg-bytes"))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := &Client{Client: server.Client(), BaseUrl: server.URL, User: "demo", ClientName: "go-subsonic-test"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, _, err := client.GetCoverArtContext(ctx, "cover-1", 300)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestNewDiskCoverArtCacheOrdersByModTime(t *testing.T) {
+	dir := t.TempDir()
+
+	names := []string{"oldest", "middle", "newest"}
+	now := time.Now()
+	for i, name := range names {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		mtime := now.Add(time.Duration(i) * time.Hour)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("Chtimes: %v", err)
+		}
+	}
+
+	cache, err := NewDiskCoverArtCache(dir, 10)
+	if err != nil {
+		t.Fatalf("NewDiskCoverArtCache: %v", err)
+	}
+	if got := cache.order; len(got) != 3 || got[0] != "oldest" || got[1] != "middle" || got[2] != "newest" {
+		t.Fatalf("expected order seeded oldest-first by ModTime, got %v", got)
+	}
+}
@@ -0,0 +1,181 @@
+package subsonic
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Middleware wraps a RoundTripper to produce another one, letting callers
+// compose retry policies, rate limiting, and logging around every request a
+// Client issues. Middlewares are applied in the order passed to Client.Use,
+// with the first middleware seeing the request first.
+type Middleware func(next RoundTripper) RoundTripper
+
+// RoundTripper performs a single HTTP round trip. It has the same shape as
+// http.Client.Do and is the unit middleware wraps.
+type RoundTripper func(req *http.Request) (*http.Response, error)
+
+// Use appends middlewares to the Client's request pipeline. Middlewares run
+// in the order given, wrapping the Client's underlying *http.Client.
+func (s *Client) Use(middlewares ...Middleware) {
+	s.middlewares = append(s.middlewares, middlewares...)
+}
+
+// roundTripper builds the effective RoundTripper for this Client: its
+// installed middlewares wrapped around a base that delegates to s.Client.Do.
+func (s *Client) roundTripper() RoundTripper {
+	rt := RoundTripper(func(req *http.Request) (*http.Response, error) {
+		return s.Client.Do(req)
+	})
+	for i := len(s.middlewares) - 1; i >= 0; i-- {
+		rt = s.middlewares[i](rt)
+	}
+	return rt
+}
+
+// WithRetry returns a Middleware that retries requests which fail with a
+// 5xx status or 429 Too Many Requests, up to maxAttempts total attempts,
+// using exponential backoff starting at baseDelay. A Retry-After response
+// header given in seconds takes precedence over the computed backoff; the
+// HTTP-date form of Retry-After is not parsed and falls back to the backoff.
+func WithRetry(maxAttempts int, baseDelay time.Duration) Middleware {
+	return func(next RoundTripper) RoundTripper {
+		return func(req *http.Request) (*http.Response, error) {
+			var resp *http.Response
+			var err error
+			for attempt := 0; attempt < maxAttempts; attempt++ {
+				if attempt > 0 && req.GetBody != nil {
+					body, err := req.GetBody()
+					if err != nil {
+						return nil, err
+					}
+					req.Body = body
+				}
+
+				resp, err = next(req)
+				if err != nil {
+					return resp, err
+				}
+				if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+					return resp, nil
+				}
+				if attempt == maxAttempts-1 {
+					return resp, nil
+				}
+
+				delay := retryDelay(resp, attempt, baseDelay)
+				resp.Body.Close()
+
+				select {
+				case <-req.Context().Done():
+					return nil, req.Context().Err()
+				case <-time.After(delay):
+				}
+			}
+			return resp, err
+		}
+	}
+}
+
+func retryDelay(resp *http.Response, attempt int, baseDelay time.Duration) time.Duration {
+	if ra := resp.Header.Get("Retry-After"); ra != "" {
+		if seconds, err := strconv.Atoi(ra); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return baseDelay * time.Duration(math.Pow(2, float64(attempt)))
+}
+
+// RateLimiter is a simple token-bucket limiter used by WithRateLimiter to
+// keep the Client well-behaved against servers that throttle or disconnect
+// clients issuing requests too quickly (e.g. Navidrome's default rate
+// limits).
+type RateLimiter struct {
+	mu         sync.Mutex
+	tokens     float64
+	maxTokens  float64
+	refillRate float64 // tokens per second
+	lastRefill time.Time
+}
+
+// NewRateLimiter creates a RateLimiter allowing up to ratePerSecond requests
+// per second on average, with bursts up to burst requests.
+func NewRateLimiter(ratePerSecond float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		tokens:     float64(burst),
+		maxTokens:  float64(burst),
+		refillRate: ratePerSecond,
+		lastRefill: time.Now(),
+	}
+}
+
+// Wait blocks until a token is available or ctx is done.
+func (r *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		wait := r.reserve()
+		if wait <= 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// reserve consumes a token if one is available and returns 0, or otherwise
+// returns how long the caller should wait before trying again.
+func (r *RateLimiter) reserve() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(r.lastRefill).Seconds()
+	r.tokens = math.Min(r.maxTokens, r.tokens+elapsed*r.refillRate)
+	r.lastRefill = now
+
+	if r.tokens >= 1 {
+		r.tokens--
+		return 0
+	}
+	missing := 1 - r.tokens
+	return time.Duration(missing/r.refillRate*1000) * time.Millisecond
+}
+
+// WithRateLimiter returns a Middleware that blocks each request until the
+// given RateLimiter admits it.
+func WithRateLimiter(limiter *RateLimiter) Middleware {
+	return func(next RoundTripper) RoundTripper {
+		return func(req *http.Request) (*http.Response, error) {
+			if err := limiter.Wait(req.Context()); err != nil {
+				return nil, err
+			}
+			return next(req)
+		}
+	}
+}
+
+// WithLogger returns a Middleware that logs each request's method,
+// endpoint, status, and duration to the given slog.Logger at Debug level,
+// and at Error level when the round trip itself fails.
+func WithLogger(logger *slog.Logger) Middleware {
+	return func(next RoundTripper) RoundTripper {
+		return func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next(req)
+			duration := time.Since(start)
+			if err != nil {
+				logger.Error("subsonic request failed", "method", req.Method, "url", req.URL.Path, "err", err, "duration", duration)
+				return resp, err
+			}
+			logger.Debug("subsonic request", "method", req.Method, "url", req.URL.Path, "status", resp.StatusCode, "duration", duration)
+			return resp, err
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package subsonic
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithRetryRetriesOn5xx(t *testing.T) {
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &Client{Client: server.Client(), BaseUrl: server.URL, User: "demo", ClientName: "go-subsonic-test"}
+	client.Use(WithRetry(5, time.Millisecond))
+
+	resp, err := client.Request("GET", "ping", nil)
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected eventual 200, got %d", resp.StatusCode)
+	}
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestWithRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := &Client{Client: server.Client(), BaseUrl: server.URL, User: "demo", ClientName: "go-subsonic-test"}
+	client.Use(WithRetry(3, time.Millisecond))
+
+	resp, err := client.Request("GET", "ping", nil)
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected a final 503 to be returned, got %d", resp.StatusCode)
+	}
+	if attempts != 3 {
+		t.Fatalf("expected exactly 3 attempts, got %d", attempts)
+	}
+}
+
+func TestRateLimiterSpacesRequests(t *testing.T) {
+	limiter := NewRateLimiter(20, 1) // ~50ms between requests after the burst
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("Wait: %v", err)
+		}
+	}
+	elapsed := time.Since(start)
+
+	// Burst of 1 means the 2nd and 3rd calls each wait ~1/20s; allow
+	// generous slack for scheduler jitter (this only needs to show the
+	// limiter didn't let all 3 through immediately, not pin exact timing).
+	if elapsed < 30*time.Millisecond {
+		t.Fatalf("expected rate limiter to space out requests, elapsed=%s", elapsed)
+	}
+}
@@ -0,0 +1,274 @@
+package subsonic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ServerInfo describes the capabilities DetectCapabilities discovered for
+// the server a Client talks to: whether it implements the OpenSubsonic
+// extensions (https://opensubsonic.netlify.app/), which ones, and its
+// reported server type and version.
+type ServerInfo struct {
+	Type          string
+	ServerVersion string
+	OpenSubsonic  bool
+	Extensions    map[string][]int
+}
+
+// openSubsonicEnvelope captures only the fields DetectCapabilities needs
+// from a ping or getOpenSubsonicExtensions response. It is decoded
+// independently of subsonicResponse so this file doesn't need to assume
+// OpenSubsonic-specific fields exist there.
+type openSubsonicEnvelope struct {
+	Response struct {
+		Type          string `json:"type"`
+		ServerVersion string `json:"serverVersion"`
+		OpenSubsonic  bool   `json:"openSubsonic"`
+		Error         *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+		OpenSubsonicExtensions []struct {
+			Name     string `json:"name"`
+			Versions []int  `json:"versions"`
+		} `json:"openSubsonicExtensions"`
+	} `json:"subsonic-response"`
+}
+
+func decodeOpenSubsonicEnvelope(body []byte) (*openSubsonicEnvelope, error) {
+	env := &openSubsonicEnvelope{}
+	if err := json.Unmarshal(body, env); err != nil {
+		return nil, err
+	}
+	if env.Response.Error != nil {
+		return nil, &ApiError{Code: env.Response.Error.Code, Message: env.Response.Error.Message}
+	}
+	return env, nil
+}
+
+// DetectCapabilities pings the server and, if it identifies itself as
+// OpenSubsonic-compatible, also fetches getOpenSubsonicExtensions. The
+// result is cached on the Client so HasExtension and capability-gated
+// endpoint wrappers can consult it without another round trip.
+func (s *Client) DetectCapabilities() (*ServerInfo, error) {
+	return s.DetectCapabilitiesContext(context.Background())
+}
+
+// DetectCapabilitiesContext is the context-aware variant of
+// DetectCapabilities.
+func (s *Client) DetectCapabilitiesContext(ctx context.Context) (*ServerInfo, error) {
+	resp, err := s.RequestContext(ctx, "GET", "ping", nil)
+	if err != nil {
+		return nil, err
+	}
+	pingBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	pingEnv, err := decodeOpenSubsonicEnvelope(pingBody)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ServerInfo{
+		Type:          pingEnv.Response.Type,
+		ServerVersion: pingEnv.Response.ServerVersion,
+		OpenSubsonic:  pingEnv.Response.OpenSubsonic,
+		Extensions:    map[string][]int{},
+	}
+
+	if info.OpenSubsonic {
+		resp, err := s.RequestContext(ctx, "GET", "getOpenSubsonicExtensions", nil)
+		if err != nil {
+			return nil, err
+		}
+		extBody, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		extEnv, err := decodeOpenSubsonicEnvelope(extBody)
+		if err != nil {
+			return nil, err
+		}
+		for _, ext := range extEnv.Response.OpenSubsonicExtensions {
+			info.Extensions[ext.Name] = ext.Versions
+		}
+	}
+
+	s.serverInfo = info
+	return info, nil
+}
+
+// HasExtension reports whether the server's last-detected capabilities
+// (via DetectCapabilities) include the named OpenSubsonic extension. It
+// returns false if DetectCapabilities has not been called yet.
+func (s *Client) HasExtension(name string) bool {
+	if s.serverInfo == nil {
+		return false
+	}
+	_, ok := s.serverInfo.Extensions[name]
+	return ok
+}
+
+// ErrExtensionUnsupported is returned by capability-gated endpoint wrappers
+// when the server has not advertised the required OpenSubsonic extension,
+// in place of letting the request reach the server and fail there.
+type ErrExtensionUnsupported struct {
+	Extension string
+}
+
+func (e *ErrExtensionUnsupported) Error() string {
+	return fmt.Sprintf("subsonic: server does not support the %q OpenSubsonic extension", e.Extension)
+}
+
+func (s *Client) requireExtension(name string) error {
+	if !s.HasExtension(name) {
+		return &ErrExtensionUnsupported{Extension: name}
+	}
+	return nil
+}
+
+// LyricLine is a single timed or untimed line of lyrics, as returned by
+// GetSongLyricsBySongId.
+type LyricLine struct {
+	Start *int   `json:"start,omitempty"`
+	Value string `json:"value"`
+}
+
+// StructuredLyrics is one set of lyrics for a song, in one language, as
+// defined by the OpenSubsonic "songLyrics" extension.
+type StructuredLyrics struct {
+	Lang   string      `json:"lang"`
+	Synced bool        `json:"synced"`
+	Line   []LyricLine `json:"line"`
+}
+
+type lyricsBySongIdEnvelope struct {
+	Response struct {
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+		LyricsList struct {
+			StructuredLyrics []StructuredLyrics `json:"structuredLyrics"`
+		} `json:"lyricsList"`
+	} `json:"subsonic-response"`
+}
+
+// GetSongLyricsBySongId retrieves structured, potentially synced lyrics for
+// a song id. It requires the server to advertise the "songLyrics"
+// OpenSubsonic extension and returns *ErrExtensionUnsupported otherwise.
+func (s *Client) GetSongLyricsBySongId(id string) ([]StructuredLyrics, error) {
+	return s.GetSongLyricsBySongIdContext(context.Background(), id)
+}
+
+// GetSongLyricsBySongIdContext is the context-aware variant of
+// GetSongLyricsBySongId.
+func (s *Client) GetSongLyricsBySongIdContext(ctx context.Context, id string) ([]StructuredLyrics, error) {
+	if err := s.requireExtension("songLyrics"); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.RequestContext(ctx, "GET", "getLyricsBySongId", map[string]string{"id": id})
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	env := lyricsBySongIdEnvelope{}
+	if err := json.Unmarshal(body, &env); err != nil {
+		return nil, err
+	}
+	if env.Response.Error != nil {
+		return nil, &ApiError{Code: env.Response.Error.Code, Message: env.Response.Error.Message}
+	}
+	return env.Response.LyricsList.StructuredLyrics, nil
+}
+
+// FormPost issues a POST request with the given params encoded as form
+// values rather than a query string, as required by OpenSubsonic's tag
+// editing endpoints (e.g. updateTags). It requires the server to advertise
+// the "tagEditing" OpenSubsonic extension.
+func (s *Client) FormPost(endpoint string, params map[string]string) error {
+	return s.FormPostContext(context.Background(), endpoint, params)
+}
+
+// FormPostContext is the context-aware variant of FormPost.
+func (s *Client) FormPostContext(ctx context.Context, endpoint string, params map[string]string) error {
+	if err := s.requireExtension("tagEditing"); err != nil {
+		return err
+	}
+
+	urlReq, err := s.buildRequest("POST", endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	form := url.Values{}
+	for key, val := range params {
+		form.Set(key, val)
+	}
+	formBody := form.Encode()
+
+	// Built via http.NewRequest (with GetBody set) rather than mutating
+	// urlReq's Body directly, so WithRetry can re-read the form data on a
+	// retried attempt instead of resending an already-drained, empty body.
+	req, err := http.NewRequest("POST", urlReq.URL.String(), strings.NewReader(formBody))
+	if err != nil {
+		return err
+	}
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(formBody)), nil
+	}
+	req.ContentLength = int64(len(formBody))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	req = req.WithContext(ctx)
+	resp, err := s.roundTripper()(req)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	env, err := decodeOpenSubsonicEnvelope(body)
+	if err != nil {
+		return err
+	}
+	if env.Response.Error != nil {
+		return &ApiError{Code: env.Response.Error.Code, Message: env.Response.Error.Message}
+	}
+	return nil
+}
+
+// StreamFromOffset is like Stream, but resumes a transcode at timeOffsetSeconds
+// into the track instead of from the beginning, via the "transcodeOffset"
+// OpenSubsonic extension's timeOffset param. It returns
+// *ErrExtensionUnsupported if the server hasn't advertised that extension.
+func (s *Client) StreamFromOffset(id string, timeOffsetSeconds int, params map[string]string) (io.ReadCloser, error) {
+	if err := s.requireExtension("transcodeOffset"); err != nil {
+		return nil, err
+	}
+
+	reqParams := map[string]string{"timeOffset": strconv.Itoa(timeOffsetSeconds)}
+	for key, val := range params {
+		reqParams[key] = val
+	}
+	return s.Stream(id, reqParams)
+}
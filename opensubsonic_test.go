@@ -0,0 +1,41 @@
+package subsonic
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFormPostRetriesWithFullBody(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"subsonic-response":{"status":"ok"}}`))
+	}))
+	defer server.Close()
+
+	client := &Client{Client: server.Client(), BaseUrl: server.URL, User: "demo", ClientName: "go-subsonic-test"}
+	client.Use(WithRetry(3, time.Millisecond))
+	client.serverInfo = &ServerInfo{OpenSubsonic: true, Extensions: map[string][]int{"tagEditing": {1}}}
+
+	if err := client.FormPost("updateTags", map[string]string{"id": "1", "genre": "Jazz"}); err != nil {
+		t.Fatalf("FormPost: %v", err)
+	}
+
+	if len(bodies) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(bodies))
+	}
+	for i, body := range bodies {
+		if body != "genre=Jazz&id=1" {
+			t.Fatalf("attempt %d: expected full form body on every attempt, got %q", i, body)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package subsonic
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// xmlSubsonicError mirrors the <error> element returned by the XML error
+// format, which some servers fall back to for /rest/stream and /rest/download
+// even when f=json is requested.
+type xmlSubsonicError struct {
+	XMLName xml.Name `xml:"subsonic-response"`
+	Error   struct {
+		Code    int    `xml:"code,attr"`
+		Message string `xml:"message,attr"`
+	} `xml:"error"`
+}
+
+// StreamError is returned by Stream and Download when the server responds
+// with a Subsonic error instead of media, regardless of whether that error
+// was encoded as XML or JSON.
+type StreamError struct {
+	Code    int
+	Message string
+}
+
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("Error #%d: %s", e.Code, e.Message)
+}
+
+// asStreamError inspects a response's Content-Type and, if it looks like a
+// Subsonic error payload rather than media, decodes and returns it as a
+// *StreamError. It returns a nil *StreamError when the response is not an
+// error.
+//
+// Detecting an XML or JSON error requires reading the body to decode it, so
+// when that body turns out not to be an error after all, asStreamError
+// returns a replacement io.ReadCloser carrying the same bytes it already
+// consumed — the caller should read from that instead of the now-drained
+// resp.Body. A nil replacement means resp.Body was never touched and reading
+// it directly is still safe.
+func asStreamError(resp *http.Response) (*StreamError, io.ReadCloser, error) {
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+
+	switch mediaType {
+	case "text/xml", "application/xml":
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, nil, err
+		}
+		parsed := xmlSubsonicError{}
+		if err := xml.Unmarshal(body, &parsed); err != nil {
+			return nil, nil, err
+		}
+		if parsed.Error.Code != 0 {
+			return &StreamError{Code: parsed.Error.Code, Message: parsed.Error.Message}, nil, nil
+		}
+		return nil, ioutil.NopCloser(bytes.NewReader(body)), nil
+	case "application/json":
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, nil, err
+		}
+		parsed := apiResponse{}
+		if err := json.Unmarshal(body, &parsed); err != nil {
+			return nil, nil, err
+		}
+		if parsed.Response != nil && parsed.Response.Error != nil {
+			return &StreamError{Code: parsed.Response.Error.Code, Message: parsed.Response.Error.Message}, nil, nil
+		}
+		return nil, ioutil.NopCloser(bytes.NewReader(body)), nil
+	default:
+		return nil, nil, nil
+	}
+}
+
+// Stream issues a request against /rest/stream for the given track or video
+// id and returns an io.ReadCloser over the media. The returned value also
+// implements io.Seeker: seeking re-issues the request with a Range header
+// against the same URL so callers (e.g. audio decoders) can seek within the
+// stream without buffering it into memory first.
+func (s *Client) Stream(id string, params map[string]string) (io.ReadCloser, error) {
+	return s.streamEndpoint("stream", id, params)
+}
+
+// Download issues a request against /rest/download for the given id and
+// returns an io.ReadCloser over the original media file, bypassing any
+// transcoding the server would otherwise apply.
+func (s *Client) Download(id string) (io.ReadCloser, error) {
+	return s.streamEndpoint("download", id, nil)
+}
+
+func (s *Client) streamEndpoint(endpoint string, id string, params map[string]string) (io.ReadCloser, error) {
+	reqParams := map[string]string{"id": id}
+	for key, val := range params {
+		reqParams[key] = val
+	}
+
+	resp, err := s.Request("GET", endpoint, reqParams)
+	if err != nil {
+		return nil, err
+	}
+
+	streamErr, replacement, err := asStreamError(resp)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if streamErr != nil {
+		resp.Body.Close()
+		return nil, streamErr
+	}
+
+	body := resp.Body
+	if replacement != nil {
+		resp.Body.Close()
+		body = replacement
+	}
+
+	size := int64(-1)
+	if cl := resp.Header.Get("Content-Length"); cl != "" {
+		if n, err := strconv.ParseInt(cl, 10, 64); err == nil {
+			size = n
+		}
+	}
+
+	// body already holds the stream from offset 0 — hand it straight to
+	// rangedStream instead of closing it and making open() re-request the
+	// same bytes. A second request here would double the server's
+	// transcoding work and, on most Subsonic servers, double-count the play.
+	return &rangedStream{
+		client:   s,
+		endpoint: endpoint,
+		params:   reqParams,
+		size:     size,
+		body:     body,
+	}, nil
+}
+
+// rangedStream implements io.ReadSeekCloser on top of repeated ranged HTTP
+// requests against the same Subsonic endpoint, rather than buffering the
+// whole body. It starts out holding the body of the initial (non-ranged)
+// request; each Seek closes the current body, and the next Read lazily
+// opens a fresh ranged request starting at the new offset.
+type rangedStream struct {
+	client   *Client
+	endpoint string
+	params   map[string]string
+
+	body   io.ReadCloser
+	offset int64
+	size   int64
+}
+
+func (r *rangedStream) open() error {
+	if r.body != nil {
+		return nil
+	}
+
+	req, err := r.client.buildRequest("GET", r.endpoint, r.params)
+	if err != nil {
+		return err
+	}
+	if r.offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+	}
+
+	resp, err := r.client.roundTripper()(req)
+	if err != nil {
+		return err
+	}
+	if r.offset > 0 && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return fmt.Errorf("subsonic: server does not support ranged streaming (status %d)", resp.StatusCode)
+	}
+
+	r.body = resp.Body
+	return nil
+}
+
+func (r *rangedStream) Read(p []byte) (int, error) {
+	if err := r.open(); err != nil {
+		return 0, err
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *rangedStream) Seek(offset int64, whence int) (int64, error) {
+	var newOffset int64
+	switch whence {
+	case io.SeekStart:
+		newOffset = offset
+	case io.SeekCurrent:
+		newOffset = r.offset + offset
+	case io.SeekEnd:
+		if r.size < 0 {
+			return 0, fmt.Errorf("subsonic: cannot seek from end of stream with unknown size")
+		}
+		newOffset = r.size + offset
+	default:
+		return 0, fmt.Errorf("subsonic: invalid whence %d", whence)
+	}
+	if newOffset < 0 {
+		return 0, fmt.Errorf("subsonic: negative seek offset %d", newOffset)
+	}
+
+	if r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = newOffset
+	return r.offset, nil
+}
+
+func (r *rangedStream) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	return r.body.Close()
+}
+
+var _ io.ReadSeekCloser = (*rangedStream)(nil)
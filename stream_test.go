@@ -0,0 +1,147 @@
+package subsonic
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestStreamDoesNotReRequestBeforeSeeking(t *testing.T) {
+	const body = "0123456789"
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		io.WriteString(w, body)
+	}))
+	defer server.Close()
+
+	client := &Client{Client: server.Client(), BaseUrl: server.URL, User: "demo", ClientName: "go-subsonic-test"}
+	stream, err := client.Stream("1", nil)
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	defer stream.Close()
+
+	got, err := ioutil.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(got) != body {
+		t.Fatalf("expected %q, got %q", body, got)
+	}
+	if requests != 1 {
+		t.Fatalf("expected exactly 1 request for an unseeked stream, got %d", requests)
+	}
+}
+
+func TestStreamSeekIssuesRangedRequest(t *testing.T) {
+	const body = "0123456789"
+	var lastRange string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastRange = r.Header.Get("Range")
+		w.Header().Set("Content-Type", "audio/mpeg")
+		if lastRange == "" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			io.WriteString(w, body)
+			return
+		}
+		w.WriteHeader(http.StatusPartialContent)
+		io.WriteString(w, strings.TrimPrefix(body, body[:5]))
+	}))
+	defer server.Close()
+
+	client := &Client{Client: server.Client(), BaseUrl: server.URL, User: "demo", ClientName: "go-subsonic-test"}
+	stream, err := client.Stream("1", nil)
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	defer stream.Close()
+
+	seeker, ok := stream.(io.Seeker)
+	if !ok {
+		t.Fatalf("Stream result does not implement io.Seeker")
+	}
+	if _, err := seeker.Seek(5, io.SeekStart); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+
+	got, err := ioutil.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(got) != body[5:] {
+		t.Fatalf("expected %q after seek, got %q", body[5:], got)
+	}
+	if lastRange != "bytes=5-" {
+		t.Fatalf("expected Range header %q, got %q", "bytes=5-", lastRange)
+	}
+}
+
+func TestStreamReturnsXmlError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		io.WriteString(w, `<subsonic-response><error code="70" message="The requested data was not found."/></subsonic-response>`)
+	}))
+	defer server.Close()
+
+	client := &Client{Client: server.Client(), BaseUrl: server.URL, User: "demo", ClientName: "go-subsonic-test"}
+	_, err := client.Stream("1", nil)
+
+	var streamErr *StreamError
+	if !errors.As(err, &streamErr) {
+		t.Fatalf("expected *StreamError, got %T: %v", err, err)
+	}
+	if streamErr.Code != 70 || streamErr.Message != "The requested data was not found." {
+		t.Fatalf("expected code 70 with the not-found message, got %+v", streamErr)
+	}
+}
+
+func TestStreamReturnsJsonError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"subsonic-response":{"status":"failed","error":{"code":70,"message":"The requested data was not found."}}}`)
+	}))
+	defer server.Close()
+
+	client := &Client{Client: server.Client(), BaseUrl: server.URL, User: "demo", ClientName: "go-subsonic-test"}
+	_, err := client.Stream("1", nil)
+
+	var streamErr *StreamError
+	if !errors.As(err, &streamErr) {
+		t.Fatalf("expected *StreamError, got %T: %v", err, err)
+	}
+	if streamErr.Code != 70 || streamErr.Message != "The requested data was not found." {
+		t.Fatalf("expected code 70 with the not-found message, got %+v", streamErr)
+	}
+}
+
+func TestStreamSurvivesNonErrorJsonContentType(t *testing.T) {
+	const body = `{"subsonic-response":{"status":"ok"}}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	}))
+	defer server.Close()
+
+	client := &Client{Client: server.Client(), BaseUrl: server.URL, User: "demo", ClientName: "go-subsonic-test"}
+	stream, err := client.Stream("1", nil)
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	defer stream.Close()
+
+	got, err := ioutil.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(got) != body {
+		t.Fatalf("expected the original body to survive error-sniffing, got %q", got)
+	}
+}